@@ -0,0 +1,495 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regexp
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// instOp identifies the kind of a compiled byte-level instruction.
+type instOp int
+
+const (
+	instFail instOp = iota
+	instNop
+	instAlt
+	instByteRange
+	instMatch
+)
+
+// inst is a single instruction in the byte-level program that the dfa is
+// built from. Unlike syntax.Prog, which transitions on runes, every
+// instByteRange instruction here consumes exactly one input byte, so
+// multi-byte UTF-8 sequences are represented as a chain of instructions.
+type inst struct {
+	op       instOp
+	out      int
+	out2     int // second branch, only used by instAlt
+	lo, hi   byte
+	matchIDs []int // pattern ids accepted at an instMatch; single-pattern builds use {0}
+}
+
+// dfaState is a single state of the (lazily built) dfa. It is identified
+// by the sorted, de-duplicated set of byte-level instruction pointers that
+// are live once all epsilon transitions have been followed.
+type dfaState struct {
+	insts []int
+	trans [256]int // 0 means "not yet computed", -1 means dead
+}
+
+const deadState = 0
+
+// dfa is a lazily constructed byte-at-a-time deterministic finite
+// automaton built from a compiled instruction list. States are computed
+// on demand by accept() and memoized so that repeated traversal (as is
+// typical when walking an FST) is cheap. A *Regexp is expected to be
+// built once and then walked repeatedly, including concurrently from
+// multiple goroutines doing independent searches, so mu guards every
+// field that lazy construction mutates after newDFA returns (insts and
+// canReach are fixed at construction and read without locking).
+type dfa struct {
+	insts []inst
+	start int // index into insts where matching begins
+
+	canReach []bool // canReach[pc] - can insts[pc] ever reach a match
+
+	mu      sync.RWMutex
+	states  []dfaState
+	byInsts map[string]int // insts-set key -> state id
+
+	maxStates int
+	// overflowed is set once maxStates has been reached and a novel
+	// instruction set has collapsed to deadState instead of becoming a
+	// real state. See stateFor and (*Regexp).Overflowed.
+	overflowed bool
+}
+
+const defaultMaxStates = 10000
+
+// newDFA builds a dfa driver around a compiled instruction list, with the
+// given instruction index as the starting point.
+func newDFA(insts []inst, start int) *dfa {
+	d := &dfa{
+		insts:     insts,
+		start:     start,
+		byInsts:   make(map[string]int),
+		maxStates: defaultMaxStates,
+	}
+	d.computeCanReach()
+	// state 0 is reserved as the dead state (empty instruction set)
+	d.states = append(d.states, dfaState{})
+	d.byInsts[""] = deadState
+	startSet := d.closure([]int{d.start})
+	d.mu.Lock()
+	d.stateFor(startSet) // ensure start is state 1, as Start() promises
+	d.mu.Unlock()
+	return d
+}
+
+// computeCanReach flags every instruction that can, by following zero or
+// more outgoing edges, eventually reach an instMatch. Threads that cannot
+// are dropped as soon as they are produced so that dead states collapse
+// immediately to deadState rather than accumulating useless instructions.
+func (d *dfa) computeCanReach() {
+	d.canReach = make([]bool, len(d.insts))
+	changed := true
+	for changed {
+		changed = false
+		for pc, in := range d.insts {
+			if d.canReach[pc] {
+				continue
+			}
+			reach := false
+			switch in.op {
+			case instMatch:
+				reach = true
+			case instNop:
+				reach = d.canReach[in.out]
+			case instAlt:
+				reach = d.canReach[in.out] || d.canReach[in.out2]
+			case instByteRange:
+				reach = d.canReach[in.out]
+			}
+			if reach {
+				d.canReach[pc] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// closure follows instNop/instAlt edges from the given set of program
+// counters, returning the sorted, de-duplicated set of instByteRange and
+// instMatch instructions reachable without consuming a byte. Instructions
+// that can never reach a match are dropped.
+func (d *dfa) closure(pcs []int) []int {
+	seen := make(map[int]bool)
+	var out []int
+	var visit func(pc int)
+	visit = func(pc int) {
+		if seen[pc] || !d.canReach[pc] {
+			return
+		}
+		seen[pc] = true
+		switch d.insts[pc].op {
+		case instNop:
+			visit(d.insts[pc].out)
+		case instAlt:
+			visit(d.insts[pc].out)
+			visit(d.insts[pc].out2)
+		case instByteRange, instMatch:
+			out = append(out, pc)
+		}
+	}
+	for _, pc := range pcs {
+		visit(pc)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// key renders an instruction-pointer set into a stable map key.
+func key(insts []int) string {
+	var sb strings.Builder
+	for i, pc := range insts {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%d", pc)
+	}
+	return sb.String()
+}
+
+// stateFor returns the state id for an instruction set, allocating a new
+// one if this is the first time it has been seen. Once the dfa has
+// allocated maxStates states, any instruction set that would require a
+// new one collapses to deadState instead and sets overflowed, which
+// Accept has no way to surface itself: see (*Regexp).Overflowed. This is
+// the only way to bound the lazily-built state count for a pathological
+// union of patterns/classes rather than growing it without limit.
+//
+// Callers must hold d.mu.
+func (d *dfa) stateFor(insts []int) int {
+	if len(insts) == 0 {
+		return deadState
+	}
+	k := key(insts)
+	if id, ok := d.byInsts[k]; ok {
+		return id
+	}
+	if len(d.states) >= d.maxStates {
+		d.overflowed = true
+		return deadState
+	}
+	id := len(d.states)
+	d.states = append(d.states, dfaState{insts: insts})
+	d.byInsts[k] = id
+	return id
+}
+
+// accept computes (and memoizes) the transition from state s on byte b.
+// A *Regexp is built once and then walked repeatedly, including from
+// multiple goroutines running independent searches over the same FST,
+// so the memoization table is guarded by d.mu rather than assuming a
+// single writer: the common case (the transition has already been
+// computed by an earlier walk) only needs a read lock.
+func (d *dfa) accept(s int, b byte) int {
+	if s == deadState {
+		return deadState
+	}
+	d.mu.RLock()
+	if s >= len(d.states) {
+		d.mu.RUnlock()
+		return deadState
+	}
+	next := d.states[s].trans[b]
+	d.mu.RUnlock()
+	if next != 0 {
+		if next == -1 {
+			return deadState
+		}
+		return next
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Another goroutine may have computed this transition while we were
+	// waiting for the write lock.
+	if s >= len(d.states) {
+		return deadState
+	}
+	if next := d.states[s].trans[b]; next != 0 {
+		if next == -1 {
+			return deadState
+		}
+		return next
+	}
+	var raw []int
+	for _, pc := range d.states[s].insts {
+		in := d.insts[pc]
+		if in.op == instByteRange && b >= in.lo && b <= in.hi {
+			raw = append(raw, in.out)
+		}
+	}
+	next = d.stateFor(d.closure(raw))
+	if next == deadState {
+		d.states[s].trans[b] = -1
+	} else {
+		d.states[s].trans[b] = next
+	}
+	return next
+}
+
+func (d *dfa) isMatch(s int) bool {
+	if s == deadState {
+		return false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if s >= len(d.states) {
+		return false
+	}
+	for _, pc := range d.states[s].insts {
+		if d.insts[pc].op == instMatch {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *dfa) canMatch(s int) bool {
+	if s == deadState {
+		return false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return s < len(d.states)
+}
+
+// matchingPatterns returns the sorted, de-duplicated set of pattern ids
+// that are matched at state s, for automata built from NewMulti/multiple
+// tagged accept instructions. A single-pattern automaton only ever
+// reports pattern id 0.
+func (d *dfa) matchingPatterns(s int) []int {
+	if s == deadState {
+		return nil
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if s >= len(d.states) {
+		return nil
+	}
+	seen := make(map[int]bool)
+	var out []int
+	for _, pc := range d.states[s].insts {
+		in := d.insts[pc]
+		if in.op != instMatch {
+			continue
+		}
+		for _, id := range in.matchIDs {
+			if !seen[id] {
+				seen[id] = true
+				out = append(out, id)
+			}
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+// hasOverflowed reports whether the dfa has ever hit its maxStates cap.
+// See (*Regexp).Overflowed.
+func (d *dfa) hasOverflowed() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.overflowed
+}
+
+// dfaBuilder compiles one or more parsed patterns down to the byte-level
+// instruction list consumed by dfa. It is shared by New (a single
+// pattern), NewMulti (a union of patterns tagged with their origin), and
+// the glob compiler, which all just need a different source of rune
+// ranges to lower.
+type dfaBuilder struct {
+	insts     []inst
+	maxStates int
+}
+
+func newDFABuilder() *dfaBuilder {
+	return &dfaBuilder{maxStates: defaultMaxStates}
+}
+
+// emit appends an instruction and returns its index.
+func (b *dfaBuilder) emit(in inst) int {
+	b.insts = append(b.insts, in)
+	return len(b.insts) - 1
+}
+
+// checkSize returns a descriptive error once the builder has grown past
+// maxStates. The per-pattern compile loops in fromSyntaxProg/compileGlob
+// check this themselves as they go, but a final fan-in altOf over all of
+// a union's patterns happens after those loops return, so callers that
+// do that (NewMultiParser, NewMultiGlob, reverseInsts) must call this
+// again afterward or the guard isn't actually tight.
+func (b *dfaBuilder) checkSize() error {
+	if len(b.insts) > b.maxStates {
+		return fmt.Errorf("regexp: pattern too large (exceeds %d instructions)", b.maxStates)
+	}
+	return nil
+}
+
+// fromSyntaxProg lowers a standard library regexp/syntax program (as
+// produced by syntax.Compile) into the byte-level instruction list,
+// tagging every accept instruction it creates with patternID. The
+// returned int is the index of the lowered start instruction.
+func (b *dfaBuilder) fromSyntaxProg(prog *syntax.Prog, patternID int) (int, error) {
+	base := len(b.insts)
+	// Reserve a 1:1 slot for every original instruction so that Out
+	// references translate with a simple offset; instRune* slots are
+	// overwritten below with the head of their expanded byte chain.
+	for range prog.Inst {
+		b.insts = append(b.insts, inst{op: instFail})
+	}
+	remap := func(pc uint32) int { return base + int(pc) }
+
+	for pc, orig := range prog.Inst {
+		idx := base + pc
+		switch orig.Op {
+		case syntax.InstFail:
+			b.insts[idx] = inst{op: instFail}
+		case syntax.InstNop, syntax.InstCapture:
+			// Capture groups aren't needed for acceptance.
+			b.insts[idx] = inst{op: instNop, out: remap(orig.Out)}
+		case syntax.InstEmptyWidth:
+			op := syntax.EmptyOp(orig.Arg)
+			if op&(syntax.EmptyWordBoundary|syntax.EmptyNoWordBoundary|syntax.EmptyBeginLine|syntax.EmptyEndLine) != 0 {
+				// \b, \B and multiline (?m)^/(?m)$ depend on the bytes
+				// on either side of the current position ((?m)^ on the
+				// one before it, (?m)$ on the one after it, \b and \B on
+				// both), and neither the epsilon-closure that reaches
+				// this instruction nor the dfa's states track those.
+				// Rather than silently treat them as always-true the way
+				// \A/\z/(?-m)^/(?-m)$ legitimately are here (those only
+				// depend on start/end of the whole matched key), reject
+				// the pattern outright.
+				return 0, fmt.Errorf("regexp: \\b, \\B and multiline (?m) ^/$ are not supported (assertion flags %#x): they depend on surrounding bytes, not just the start/end of the matched key", uint8(op))
+			}
+			// EmptyBeginText/EmptyEndText (\A, \z, and ^/$ without
+			// (?m)) are satisfied implicitly because callers always
+			// match a whole FST key from its first byte to its last.
+			b.insts[idx] = inst{op: instNop, out: remap(orig.Out)}
+		case syntax.InstAlt, syntax.InstAltMatch:
+			b.insts[idx] = inst{op: instAlt, out: remap(orig.Out), out2: remap(orig.Arg)}
+		case syntax.InstMatch:
+			b.insts[idx] = inst{op: instMatch, matchIDs: []int{patternID}}
+		case syntax.InstRune, syntax.InstRune1, syntax.InstRuneAny, syntax.InstRuneAnyNotNL:
+			ranges := runesOf(orig)
+			alt, err := b.lowerRuneRanges(ranges, remap(orig.Out))
+			if err != nil {
+				return 0, err
+			}
+			b.insts[idx] = b.insts[alt]
+			if alt != idx {
+				b.insts[alt] = inst{op: instFail}
+			}
+		default:
+			return 0, fmt.Errorf("regexp: unsupported instruction %v", orig.Op)
+		}
+		if len(b.insts) > b.maxStates {
+			return 0, fmt.Errorf("regexp: pattern too large (exceeds %d instructions)", b.maxStates)
+		}
+	}
+	return remap(uint32(prog.Start)), nil
+}
+
+// runesOf normalizes the three rune-bearing instruction ops down to a
+// flat list of [lo, hi] rune range pairs, covering the full Unicode
+// range: '.' matches any rune, not just any ASCII byte.
+func runesOf(in syntax.Inst) []rune {
+	switch in.Op {
+	case syntax.InstRuneAny:
+		return []rune{0, maxRune4}
+	case syntax.InstRuneAnyNotNL:
+		return []rune{0, '\n' - 1, '\n' + 1, maxRune4}
+	default:
+		if len(in.Rune) == 1 {
+			// A single-rune slice came from a literal, not a character
+			// class; syntax.Compile leaves case-folding for it to be
+			// applied at match time (see Inst.MatchRunePos), so the
+			// fold orbit has to be expanded into a rune set here.
+			r0 := in.Rune[0]
+			if syntax.Flags(in.Arg)&syntax.FoldCase == 0 {
+				return []rune{r0, r0}
+			}
+			ranges := []rune{r0, r0}
+			for r1 := unicode.SimpleFold(r0); r1 != r0; r1 = unicode.SimpleFold(r1) {
+				ranges = append(ranges, r1, r1)
+			}
+			return ranges
+		}
+		return in.Rune
+	}
+}
+
+// lowerRuneRanges builds the alternation of byte-chains matching any rune
+// in the given [lo,hi] pairs, each chain terminating at out, and returns
+// the index of the (possibly synthetic) instruction that starts it.
+//
+// Each range is decomposed into one or more UTF-8 byte-range sequences
+// via utf8Sequences, so a rune range spanning multiple UTF-8 encoded
+// lengths (say, ASCII through astral-plane runes in \p{L}) lowers to a
+// handful of 1-4 byte chains rather than requiring the caller to already
+// be working one rune at a time.
+func (b *dfaBuilder) lowerRuneRanges(ranges []rune, out int) (int, error) {
+	var branches []int
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for _, seq := range utf8Sequences(ranges[i], ranges[i+1]) {
+			branches = append(branches, b.chainByteRangeSeq(seq, out))
+		}
+	}
+	return b.altOf(branches), nil
+}
+
+// chainByteRangeSeq appends the instructions for one UTF-8 byte-range
+// sequence, first byte to last, terminating at out.
+func (b *dfaBuilder) chainByteRangeSeq(seq []byteRange, out int) int {
+	for i := len(seq) - 1; i >= 0; i-- {
+		out = b.chainByteRange(seq[i].lo, seq[i].hi, out)
+	}
+	return out
+}
+
+// chainByteRange appends a single-byte-consuming instruction.
+func (b *dfaBuilder) chainByteRange(lo, hi byte, out int) int {
+	return b.emit(inst{op: instByteRange, lo: lo, hi: hi, out: out})
+}
+
+// altOf returns a chain of instAlt joining all the branches, or the lone
+// branch if there is only one, or instFail if there are none.
+func (b *dfaBuilder) altOf(branches []int) int {
+	if len(branches) == 0 {
+		return b.emit(inst{op: instFail})
+	}
+	cur := branches[0]
+	for _, br := range branches[1:] {
+		cur = b.emit(inst{op: instAlt, out: cur, out2: br})
+	}
+	return cur
+}
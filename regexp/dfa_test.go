@@ -0,0 +1,90 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regexp
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestDFAStateCap confirms that once a dfa has allocated maxStates
+// states, further novel instruction sets collapse to deadState instead
+// of growing d.states without bound, and that the overflow is recorded
+// rather than silently indistinguishable from a genuine non-match.
+func TestDFAStateCap(t *testing.T) {
+	r, err := New(`[a-c][a-c][a-c][a-c]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Overflowed() {
+		t.Fatal("expected a fresh Regexp to not be overflowed")
+	}
+	r.dfa.maxStates = len(r.dfa.states) // no room for any further state
+
+	s := r.Start()
+	for _, b := range []byte("abca") {
+		s = r.Accept(s, b)
+	}
+	if s != deadState {
+		t.Errorf("expected the capped dfa to fall back to deadState, got %d", s)
+	}
+	if got := len(r.dfa.states); got != r.dfa.maxStates {
+		t.Errorf("expected state count to stay at the cap %d, got %d", r.dfa.maxStates, got)
+	}
+	if !r.Overflowed() {
+		t.Error("expected Overflowed to report true once the state cap was hit")
+	}
+}
+
+// TestDFAConcurrentAccept walks the same compiled Regexp from many
+// goroutines at once, as callers are expected to be able to do when
+// running independent searches over a shared FST. Run with -race, this
+// catches data races in the lazily-built state table (dfa.stateFor,
+// dfa.accept, dfa.closure) rather than just checking the end result.
+func TestDFAConcurrentAccept(t *testing.T) {
+	r, err := New(`[a-c]*(foo|bar|baz)[a-c]*`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines = 16
+	const iterations = 2000
+	seqs := [][]byte{
+		[]byte("aabfooc"),
+		[]byte("bazcc"),
+		[]byte("nomatch"),
+		[]byte("cbar"),
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(seed int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				seq := seqs[(seed+i)%len(seqs)]
+				s := r.Start()
+				for _, b := range seq {
+					if s = r.Accept(s, b); s == deadState {
+						break
+					}
+				}
+				_ = r.IsMatch(s)
+				_ = r.CanMatch(s)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,294 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regexp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// globSeparator is the byte that '*' refuses to cross and '**' is happy
+// to, mirroring path.Match and the wildmatch conventions shell globs
+// follow.
+const globSeparator = '/'
+
+// globAtom is one element of a parsed glob pattern.
+type globAtom interface{ isGlobAtom() }
+
+// globLiteral matches the exact bytes it holds; parseGlob makes one per
+// escaped or literal byte of the pattern.
+type globLiteral struct{ b []byte }
+
+// globAnyByte matches any single byte other than globSeparator ('?').
+type globAnyByte struct{}
+
+// globAnyRun matches zero or more bytes, none of them globSeparator ('*').
+type globAnyRun struct{}
+
+// globDoubleStar matches zero or more bytes, including globSeparator ('**').
+type globDoubleStar struct{}
+
+// globByteRange is an inclusive [lo, hi] byte range used inside a class.
+type globByteRange struct{ lo, hi byte }
+
+// globClass matches one byte drawn from (or, if negated, excluded from)
+// ranges ('[abc]', '[a-z]', '[!a-z]').
+type globClass struct {
+	ranges  []globByteRange
+	negated bool
+}
+
+func (globLiteral) isGlobAtom()    {}
+func (globAnyByte) isGlobAtom()    {}
+func (globAnyRun) isGlobAtom()     {}
+func (globDoubleStar) isGlobAtom() {}
+func (globClass) isGlobAtom()      {}
+
+// parseGlob lowers a shell-style glob pattern into a sequence of atoms.
+// The grammar follows path.Match (*, ?, [set]) plus '**' for a
+// recursive-wildcard that is also allowed to match globSeparator, and '\'
+// for escaping any of the above.
+func parseGlob(pattern string) ([]globAtom, error) {
+	var atoms []globAtom
+	r := []byte(pattern)
+	for i := 0; i < len(r); i++ {
+		switch c := r[i]; c {
+		case '*':
+			if i+1 < len(r) && r[i+1] == '*' {
+				atoms = append(atoms, globDoubleStar{})
+				i++
+			} else {
+				atoms = append(atoms, globAnyRun{})
+			}
+		case '?':
+			atoms = append(atoms, globAnyByte{})
+		case '\\':
+			if i+1 >= len(r) {
+				return nil, fmt.Errorf("regexp: glob %q ends in a trailing escape", pattern)
+			}
+			i++
+			atoms = append(atoms, globLiteral{b: []byte{r[i]}})
+		case '[':
+			cls, next, err := parseGlobClass(r, i)
+			if err != nil {
+				return nil, err
+			}
+			atoms = append(atoms, cls)
+			i = next
+		default:
+			atoms = append(atoms, globLiteral{b: []byte{c}})
+		}
+	}
+	return atoms, nil
+}
+
+// parseGlobClass parses a '[...]' character class starting at open (the
+// index of '['), returning the class and the index of its closing ']'.
+func parseGlobClass(pattern []byte, open int) (globClass, int, error) {
+	i := open + 1
+	var cls globClass
+	if i < len(pattern) && pattern[i] == '!' {
+		cls.negated = true
+		i++
+	}
+	start := i
+	for i < len(pattern) && (pattern[i] != ']' || i == start) {
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+		hi := lo
+		if i+1 < len(pattern) && pattern[i+1] == '-' && i+2 < len(pattern) && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			i += 2
+		}
+		cls.ranges = append(cls.ranges, globByteRange{lo: lo, hi: hi})
+		i++
+	}
+	if i >= len(pattern) {
+		return globClass{}, 0, fmt.Errorf("regexp: glob class starting at %d is missing a closing ']'", open)
+	}
+	return cls, i, nil
+}
+
+// NewGlob compiles a shell-style glob pattern into a Regexp, so that it
+// can be streamed against an FST the same way New's regular expressions
+// are: Start/Accept/IsMatch/CanMatch all behave identically, the only
+// difference is the syntax that produced the underlying dfa.
+func NewGlob(pattern string) (*Regexp, error) {
+	atoms, err := parseGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	b := newDFABuilder()
+	start, err := b.compileGlob(atoms, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Regexp{
+		orig:   pattern,
+		dfa:    newDFA(b.insts, start),
+		prefix: globPrefix(atoms),
+	}, nil
+}
+
+// NewMultiGlob is NewGlob's counterpart to NewMulti: it compiles many
+// glob patterns into one automaton recognizing their union, readable
+// back with Regexp.MatchingPatterns.
+func NewMultiGlob(patterns []string) (*Regexp, error) {
+	if len(patterns) > maxMultiPatterns {
+		return nil, fmt.Errorf("regexp: %d patterns exceeds the maximum of %d supported in a single union automaton", len(patterns), maxMultiPatterns)
+	}
+	b := newDFABuilder()
+	starts := make([]int, 0, len(patterns))
+	for i, pattern := range patterns {
+		atoms, err := parseGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("regexp: pattern %d (%q): %w", i, pattern, err)
+		}
+		start, err := b.compileGlob(atoms, i)
+		if err != nil {
+			return nil, fmt.Errorf("regexp: pattern %d (%q): %w", i, pattern, err)
+		}
+		starts = append(starts, start)
+	}
+	altStart := b.altOf(starts)
+	if err := b.checkSize(); err != nil {
+		return nil, err
+	}
+	return &Regexp{
+		orig:          strings.Join(patterns, "|"),
+		dfa:           newDFA(b.insts, altStart),
+		patternStarts: starts,
+	}, nil
+}
+
+// globPrefix returns the longest run of literal bytes that every match of
+// atoms must begin with, i.e. the leading globLiteral atoms concatenated
+// together.
+func globPrefix(atoms []globAtom) []byte {
+	var prefix []byte
+	for _, a := range atoms {
+		lit, ok := a.(globLiteral)
+		if !ok {
+			break
+		}
+		prefix = append(prefix, lit.b...)
+	}
+	return prefix
+}
+
+// compileGlob lowers a parsed glob pattern into the builder's byte-level
+// instruction list, returning the index to start matching from.
+func (b *dfaBuilder) compileGlob(atoms []globAtom, patternID int) (int, error) {
+	out := b.emit(inst{op: instMatch, matchIDs: []int{patternID}})
+	for i := len(atoms) - 1; i >= 0; i-- {
+		var err error
+		out, err = b.lowerGlobAtom(atoms[i], out)
+		if err != nil {
+			return 0, err
+		}
+		if len(b.insts) > b.maxStates {
+			return 0, fmt.Errorf("regexp: glob pattern too large (exceeds %d instructions)", b.maxStates)
+		}
+	}
+	return out, nil
+}
+
+func (b *dfaBuilder) lowerGlobAtom(a globAtom, out int) (int, error) {
+	switch v := a.(type) {
+	case globLiteral:
+		for i := len(v.b) - 1; i >= 0; i-- {
+			out = b.chainByteRange(v.b[i], v.b[i], out)
+		}
+		return out, nil
+	case globAnyByte:
+		return b.altOf(b.notSeparatorBranches(out)), nil
+	case globAnyRun:
+		return b.starOf(func(loop int) []int { return b.notSeparatorBranches(loop) }, out), nil
+	case globDoubleStar:
+		return b.starOf(func(loop int) []int {
+			return []int{b.chainByteRange(0x00, 0xff, loop)}
+		}, out), nil
+	case globClass:
+		branches, err := b.classBranches(v, out)
+		if err != nil {
+			return 0, err
+		}
+		return b.altOf(branches), nil
+	default:
+		return 0, fmt.Errorf("regexp: unhandled glob atom %T", a)
+	}
+}
+
+// notSeparatorBranches returns byte-range branches, each transitioning to
+// out, matching any single byte other than globSeparator.
+func (b *dfaBuilder) notSeparatorBranches(out int) []int {
+	var branches []int
+	if globSeparator > 0x00 {
+		branches = append(branches, b.chainByteRange(0x00, globSeparator-1, out))
+	}
+	if globSeparator < 0xff {
+		branches = append(branches, b.chainByteRange(globSeparator+1, 0xff, out))
+	}
+	return branches
+}
+
+// classBranches returns byte-range branches, each transitioning to out,
+// matching one byte as described by cls.
+func (b *dfaBuilder) classBranches(cls globClass, out int) ([]int, error) {
+	if !cls.negated {
+		branches := make([]int, 0, len(cls.ranges))
+		for _, rg := range cls.ranges {
+			branches = append(branches, b.chainByteRange(rg.lo, rg.hi, out))
+		}
+		return branches, nil
+	}
+	var included [256]bool
+	for _, rg := range cls.ranges {
+		for v := int(rg.lo); v <= int(rg.hi); v++ {
+			included[v] = true
+		}
+	}
+	var branches []int
+	lo := -1
+	for v := 0; v < 256; v++ {
+		if !included[v] {
+			if lo == -1 {
+				lo = v
+			}
+			continue
+		}
+		if lo != -1 {
+			branches = append(branches, b.chainByteRange(byte(lo), byte(v-1), out))
+			lo = -1
+		}
+	}
+	if lo != -1 {
+		branches = append(branches, b.chainByteRange(byte(lo), 0xff, out))
+	}
+	return branches, nil
+}
+
+// starOf builds a zero-or-more loop: branches(loop) describes the ways to
+// consume one more repetition and return to the loop instruction, out is
+// taken once zero (more) repetitions are chosen.
+func (b *dfaBuilder) starOf(branches func(loop int) []int, out int) int {
+	loop := b.emit(inst{op: instAlt})
+	body := b.altOf(branches(loop))
+	b.insts[loop] = inst{op: instAlt, out: body, out2: out}
+	return loop
+}
@@ -0,0 +1,105 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regexp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		query    string
+		seq      []byte
+		isMatch  bool
+		canMatch bool
+	}{
+		// literal
+		{query: `cat`, seq: []byte("cat"), isMatch: true, canMatch: true},
+		{query: `cat`, seq: []byte("ca"), isMatch: false, canMatch: true},
+		{query: `cat`, seq: []byte("cats"), isMatch: false, canMatch: false},
+		// '?' matches exactly one byte, never the separator
+		{query: `ca?`, seq: []byte("cat"), isMatch: true, canMatch: true},
+		{query: `ca?`, seq: []byte("ca/"), isMatch: false, canMatch: false},
+		// '*' matches a run of bytes, but not across a separator
+		{query: `a*z`, seq: []byte("az"), isMatch: true, canMatch: true},
+		{query: `a*z`, seq: []byte("abcz"), isMatch: true, canMatch: true},
+		{query: `a*z`, seq: []byte("ab"), isMatch: false, canMatch: true},
+		{query: `a*z`, seq: []byte("a/z"), isMatch: false, canMatch: false},
+		// '**' matches a run of bytes, including a separator
+		{query: `a**z`, seq: []byte("a/b/z"), isMatch: true, canMatch: true},
+		{query: `a**z`, seq: []byte("az"), isMatch: true, canMatch: true},
+		// character classes
+		{query: `[a-c]at`, seq: []byte("bat"), isMatch: true, canMatch: true},
+		{query: `[a-c]at`, seq: []byte("dat"), isMatch: false, canMatch: false},
+		{query: `[!a-c]at`, seq: []byte("dat"), isMatch: true, canMatch: true},
+		{query: `[!a-c]at`, seq: []byte("bat"), isMatch: false, canMatch: false},
+		// escaping a glob metacharacter
+		{query: `a\*b`, seq: []byte("a*b"), isMatch: true, canMatch: true},
+		{query: `a\*b`, seq: []byte("axb"), isMatch: false, canMatch: false},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s - %v", test.query, test.seq), func(t *testing.T) {
+			r, err := NewGlob(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := r.Start()
+			for _, b := range test.seq {
+				s = r.Accept(s, b)
+			}
+
+			if isMatch := r.IsMatch(s); isMatch != test.isMatch {
+				t.Errorf("expected isMatch %t, got %t", test.isMatch, isMatch)
+			}
+			if canMatch := r.CanMatch(s); canMatch != test.canMatch {
+				t.Errorf("expected canMatch %t, got %t", test.canMatch, canMatch)
+			}
+		})
+	}
+}
+
+func TestGlobPrefix(t *testing.T) {
+	tests := []struct {
+		query  string
+		prefix string
+	}{
+		{query: `cat`, prefix: "cat"},
+		{query: `cat*`, prefix: "cat"},
+		{query: `ca?`, prefix: "ca"},
+		{query: `*cat`, prefix: ""},
+		{query: `a[bc]d`, prefix: "a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			r, err := NewGlob(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(r.Prefix()); got != test.prefix {
+				t.Errorf("expected prefix %q, got %q", test.prefix, got)
+			}
+		})
+	}
+}
+
+func BenchmarkNewGlob(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		NewGlob("a/**/*.go")
+	}
+}
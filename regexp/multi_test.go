@@ -0,0 +1,113 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regexp
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNewMulti(t *testing.T) {
+	tests := []struct {
+		seq     []byte
+		matches []int
+	}{
+		{seq: []byte("cat"), matches: []int{0}},
+		{seq: []byte("dog"), matches: []int{1}},
+		{seq: []byte("cow"), matches: []int{0, 2}},
+		{seq: []byte("fish"), matches: nil},
+	}
+
+	r, err := NewMulti([]string{`cat|cow`, `dog`, `c.w`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v", test.seq), func(t *testing.T) {
+			s := r.Start()
+			for _, b := range test.seq {
+				s = r.Accept(s, b)
+			}
+			if !r.IsMatch(s) && test.matches != nil {
+				t.Fatalf("expected a match, got none")
+			}
+			got := r.MatchingPatterns(s)
+			if !reflect.DeepEqual(got, test.matches) {
+				t.Errorf("expected matching patterns %v, got %v", test.matches, got)
+			}
+		})
+	}
+}
+
+func TestNewMultiGlob(t *testing.T) {
+	r, err := NewMultiGlob([]string{`*.go`, `*_test.go`, `main.go`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := `*.go|*_test.go|main.go`, r.String(); got != want {
+		t.Errorf("expected String() %q, got %q", want, got)
+	}
+
+	tests := []struct {
+		seq     []byte
+		matches []int
+	}{
+		{seq: []byte("dfa.go"), matches: []int{0}},
+		{seq: []byte("dfa_test.go"), matches: []int{0, 1}},
+		{seq: []byte("main.go"), matches: []int{0, 2}},
+		{seq: []byte("README.md"), matches: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.seq), func(t *testing.T) {
+			s := r.Start()
+			for _, b := range test.seq {
+				s = r.Accept(s, b)
+			}
+			got := r.MatchingPatterns(s)
+			if !reflect.DeepEqual(got, test.matches) {
+				t.Errorf("expected matching patterns %v, got %v", test.matches, got)
+			}
+		})
+	}
+}
+
+func TestNewMultiTooManyPatterns(t *testing.T) {
+	patterns := make([]string, maxMultiPatterns+1)
+	for i := range patterns {
+		patterns[i] = "a"
+	}
+	if _, err := NewMulti(patterns); err == nil {
+		t.Fatal("expected an error for too many patterns, got nil")
+	}
+}
+
+// TestNewMultiChecksSizeAfterFanIn confirms that NewMulti errors rather
+// than silently exceeding maxStates: the per-pattern compile loop can
+// finish comfortably under the cap, but the instAlt fan-in nodes altOf
+// adds afterward to join every pattern's start can still push the total
+// over it.
+func TestNewMultiChecksSizeAfterFanIn(t *testing.T) {
+	patterns := make([]string, 930)
+	for i := range patterns {
+		patterns[i] = fmt.Sprintf("a%d", i)
+	}
+	if _, err := NewMulti(patterns); err == nil {
+		t.Fatal("expected an error once the post-loop fan-in exceeds the state cap, got nil")
+	}
+}
@@ -0,0 +1,193 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package regexp implements vellum's Automaton interface on top of the
+// standard library's regexp/syntax parser, so that a regular expression
+// can be streamed directly against an FST: the caller walks the FST and
+// this automaton's transitions in lock-step, one input byte at a time,
+// rather than enumerating keys and testing each one against a compiled
+// regexp.Regexp.
+package regexp
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// maxMultiPatterns bounds how many patterns NewMulti/NewMultiGlob will
+// union into a single automaton, so a pathological input (thousands of
+// alternations) fails fast with a clear error instead of slowly building
+// a dfa that exhausts memory.
+const maxMultiPatterns = 4096
+
+// Regexp implements vellum.Automaton, matching a byte sequence against a
+// regular expression. Once built, a *Regexp is safe for concurrent use
+// by multiple goroutines, mirroring the standard library's
+// regexp.Regexp: its dfa is constructed lazily as new byte sequences are
+// walked, and that construction is internally synchronized.
+type Regexp struct {
+	orig   string
+	dfa    *dfa
+	prefix []byte
+
+	// patternStarts holds, for a Regexp built by NewMulti/NewMultiGlob,
+	// the instruction index each pattern's own compiled program begins
+	// at, indexed by pattern ID. It is nil for a single-pattern Regexp.
+	// Reverse uses it to keep per-pattern identity through the reversal;
+	// without it, every pattern's matchID would be indistinguishable by
+	// the time a reversed walk reaches the (shared) original start.
+	patternStarts []int
+}
+
+// New creates a new Regexp for the given regular expression pattern.
+func New(expr string) (*Regexp, error) {
+	return NewParser(expr, &Utf8Parser{})
+}
+
+// Parser is implemented by anything that can turn a string expression
+// into a compiled program. It exists so that callers (and other
+// constructors in this package) can plug in their own syntax on top of
+// the same dfa-building machinery that New uses.
+type Parser interface {
+	Parse(expr string) (*syntax.Prog, error)
+}
+
+// NewParser creates a new Regexp for the given expression using the
+// supplied Parser to compile it.
+func NewParser(expr string, parser Parser) (*Regexp, error) {
+	prog, err := parser.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	b := newDFABuilder()
+	start, err := b.fromSyntaxProg(prog, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Regexp{
+		orig: expr,
+		dfa:  newDFA(b.insts, start),
+	}, nil
+}
+
+// NewMulti compiles many regular expressions into one automaton
+// recognizing their union, so that a single FST walk can report every
+// pattern that matches a given key instead of repeating the walk once
+// per pattern. Use MatchingPatterns to read back which of the input
+// patterns (by index into patterns) matched at a given state.
+func NewMulti(patterns []string) (*Regexp, error) {
+	return NewMultiParser(patterns, &Utf8Parser{})
+}
+
+// NewMultiParser is NewMulti with a caller-supplied Parser, mirroring
+// NewParser.
+func NewMultiParser(patterns []string, parser Parser) (*Regexp, error) {
+	if len(patterns) > maxMultiPatterns {
+		return nil, fmt.Errorf("regexp: %d patterns exceeds the maximum of %d supported in a single union automaton", len(patterns), maxMultiPatterns)
+	}
+	b := newDFABuilder()
+	starts := make([]int, 0, len(patterns))
+	for i, expr := range patterns {
+		prog, err := parser.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("regexp: pattern %d (%q): %w", i, expr, err)
+		}
+		start, err := b.fromSyntaxProg(prog, i)
+		if err != nil {
+			return nil, fmt.Errorf("regexp: pattern %d (%q): %w", i, expr, err)
+		}
+		starts = append(starts, start)
+	}
+	altStart := b.altOf(starts)
+	if err := b.checkSize(); err != nil {
+		return nil, err
+	}
+	return &Regexp{
+		orig:          strings.Join(patterns, "|"),
+		dfa:           newDFA(b.insts, altStart),
+		patternStarts: starts,
+	}, nil
+}
+
+// Utf8Parser is the default Parser, compiling Perl-syntax regular
+// expressions with the standard library's regexp/syntax package.
+type Utf8Parser struct{}
+
+// Parse implements Parser.
+func (p *Utf8Parser) Parse(expr string) (*syntax.Prog, error) {
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	parsed = parsed.Simplify()
+	return syntax.Compile(parsed)
+}
+
+// String returns the original pattern this Regexp was built from.
+func (r *Regexp) String() string {
+	return r.orig
+}
+
+// Start returns the start state of the automaton.
+func (r *Regexp) Start() int {
+	return 1
+}
+
+// IsMatch returns true if the given state is a match.
+func (r *Regexp) IsMatch(s int) bool {
+	return r.dfa.isMatch(s)
+}
+
+// CanMatch returns true if the given state can lead to a match.
+func (r *Regexp) CanMatch(s int) bool {
+	return r.dfa.canMatch(s)
+}
+
+// Accept transitions from the state on the given byte, returning the
+// resulting state.
+func (r *Regexp) Accept(s int, b byte) int {
+	return r.dfa.accept(s, b)
+}
+
+// MatchingPatterns returns the sorted, de-duplicated indices (into the
+// patterns slice passed to NewMulti/NewMultiGlob) of every pattern
+// satisfied at state s. A Regexp built from New or NewGlob only ever has
+// a single pattern, index 0.
+func (r *Regexp) MatchingPatterns(s int) []int {
+	return r.dfa.matchingPatterns(s)
+}
+
+// Overflowed reports whether this Regexp's lazily-built dfa has ever hit
+// its internal state cap (see maxStates in dfa.go). Once true, IsMatch
+// and CanMatch may wrongly report no match for some keys that actually
+// do match, because the dfa started collapsing newly-needed states to
+// deadState instead of growing further, rather than exhausting memory
+// on a pathological pattern; callers that require correctness over
+// liveness should check this after a walk and treat a match-free result
+// as unreliable rather than as a verified non-match.
+func (r *Regexp) Overflowed() bool {
+	return r.dfa.hasOverflowed()
+}
+
+// Prefix returns, for a Regexp built by NewGlob, the leading literal
+// bytes that every match of the glob begins with, or nil if the glob
+// starts with a wildcard or class. Callers can seek their FST iterator
+// to this prefix before walking the automaton, rather than scanning
+// from the very first key. Only NewGlob computes a prefix: a Regexp
+// built by New, NewParser, NewMulti, NewMultiParser, NewMultiGlob or
+// Reverse always returns nil, even when all its matches share one.
+func (r *Regexp) Prefix() []byte {
+	return r.prefix
+}
@@ -245,6 +245,25 @@ func TestRegexp(t *testing.T) {
 
 }
 
+func TestRegexpRejectsContextSensitiveAssertions(t *testing.T) {
+	// \b, \B and multiline ^/$ depend on the bytes on either side of
+	// the current position, which the dfa builder does not track when
+	// it resolves an epsilon-closure, so patterns using them are
+	// rejected outright rather than silently treated as always-true.
+	for _, query := range []string{`\Bfoo`, `foo\bbar`, `foo(?m)^bar`, `foo(?m)$bar`} {
+		if _, err := New(query); err == nil {
+			t.Errorf("expected %q to be rejected, got nil error", query)
+		}
+	}
+
+	// \A and \z (and ^/$ without (?m)) only depend on the start/end of
+	// the matched key, which every walk already guarantees, so they
+	// still work.
+	if _, err := New(`\Afoo\z`); err != nil {
+		t.Errorf("expected \\Afoo\\z to compile, got %v", err)
+	}
+}
+
 func BenchmarkNewWildcard(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		New("my.*h")
@@ -0,0 +1,120 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regexp
+
+import "fmt"
+
+// Reverse returns a new Regexp recognizing the reversal of the regular
+// language this one recognizes: Reverse of "foo.*bar" matches "rab.*oof".
+// Combined with the original, forward-matching Regexp, this enables an
+// anchored infix search over an FST: build the forward dfa for ".*P" and
+// walk it against the FST as usual, and build P.Reverse() and walk it
+// against the same FST with keys stored (or iterated) in reverse, then
+// a key is an infix match only if both walks accept it. This is the same
+// two-pass trick used to accelerate inner-literal searches. If r was
+// built by NewMulti/NewMultiGlob, MatchingPatterns on the result still
+// reports the pattern that produced each match.
+//
+// Reverse can return an error: it adds a byte-range node per consuming
+// edge plus fan-in instAlt nodes wherever several edges share a target,
+// so the reversed program is routinely larger than r's own and can
+// exceed maxStates even when r is comfortably under it.
+func (r *Regexp) Reverse() (*Regexp, error) {
+	insts, start, err := reverseInsts(r.dfa.insts, r.dfa.start, r.patternStarts)
+	if err != nil {
+		return nil, err
+	}
+	return &Regexp{
+		orig: r.orig,
+		dfa:  newDFA(insts, start),
+	}, nil
+}
+
+// reverseInsts builds the byte-level instruction list for the automaton
+// that accepts exactly the reversals of the strings insts (rooted at
+// start) accepts. It works directly on the NFA insts is built from,
+// before subset construction, by inverting every edge: a consuming edge
+// i -[lo,hi]-> out becomes out -[lo,hi]-> i, and an epsilon edge i -> out
+// becomes out -> i. The original accept (instMatch) instructions become
+// the new start, reached through a fan-in instAlt.
+//
+// patternStarts, if non-nil, is the per-pattern entry point recorded by
+// NewMulti/NewMultiGlob (indexed by pattern ID): each one becomes an
+// instMatch tagged with that pattern's ID, so MatchingPatterns still
+// reports the right pattern after reversal. All of a multi-pattern
+// automaton's entry points are fed by the same shared fan-in instAlt, so
+// by the time a reversed walk reaches the overall start (as the
+// single-pattern case below does), the patterns are no longer
+// distinguishable; tagging has to happen at each pattern's own start
+// instead. patternStarts is nil for a single-pattern Regexp, which only
+// ever has one original start and one pattern ID (0).
+func reverseInsts(insts []inst, start int, patternStarts []int) ([]inst, int, error) {
+	n := len(insts)
+	incoming := make([][]int, n) // incoming[x] = reversed branches that lead to node x
+
+	b := newDFABuilder()
+	for i := 0; i < n; i++ {
+		b.insts = append(b.insts, inst{op: instFail})
+	}
+
+	var matchNodes []int
+	for i, in := range insts {
+		switch in.op {
+		case instNop:
+			incoming[in.out] = append(incoming[in.out], i)
+		case instAlt:
+			incoming[in.out] = append(incoming[in.out], i)
+			incoming[in.out2] = append(incoming[in.out2], i)
+		case instByteRange:
+			node := b.chainByteRange(in.lo, in.hi, i)
+			incoming[in.out] = append(incoming[in.out], node)
+		case instMatch:
+			matchNodes = append(matchNodes, i)
+		case instFail:
+			// contributes no edges
+		}
+	}
+
+	patternIDFor := make(map[int]int, len(patternStarts))
+	for id, s := range patternStarts {
+		patternIDFor[s] = id
+	}
+
+	for i := 0; i < n; i++ {
+		branches := incoming[i]
+		if patternStarts == nil {
+			if i == start {
+				branches = append(branches, b.emit(inst{op: instMatch, matchIDs: []int{0}}))
+			}
+		} else if id, ok := patternIDFor[i]; ok {
+			branches = append(branches, b.emit(inst{op: instMatch, matchIDs: []int{id}}))
+		}
+		// Indirect through a nop rather than relocating whatever altOf
+		// returns into slot i: branches can legitimately point back at
+		// other not-yet-finalized reserved slots, and overwriting one of
+		// those in place (as fromSyntaxProg does for freshly synthesized
+		// nodes) would clobber it before its own turn in this loop.
+		b.insts[i] = inst{op: instNop, out: b.altOf(branches)}
+		if len(b.insts) > b.maxStates {
+			return nil, 0, fmt.Errorf("regexp: pattern too large to reverse (exceeds %d instructions)", b.maxStates)
+		}
+	}
+
+	newStart := b.altOf(matchNodes)
+	if err := b.checkSize(); err != nil {
+		return nil, 0, err
+	}
+	return b.insts, newStart, nil
+}
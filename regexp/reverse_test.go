@@ -0,0 +1,174 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regexp
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		out[len(b)-1-i] = c
+	}
+	return out
+}
+
+func TestReverse(t *testing.T) {
+	tests := []struct {
+		query    string
+		seq      []byte
+		isMatch  bool
+		canMatch bool
+	}{
+		// plain literal
+		{query: `cat`, seq: []byte("tac"), isMatch: true, canMatch: true},
+		{query: `cat`, seq: []byte("cat"), isMatch: false, canMatch: false},
+		// alternation
+		{query: `a+|b+`, seq: []byte("aa"), isMatch: true, canMatch: true},
+		{query: `a+|b+`, seq: []byte("bb"), isMatch: true, canMatch: true},
+		{query: `a+|b+`, seq: []byte("ab"), isMatch: false, canMatch: false},
+		// character classes, including a case-insensitive fold
+		{query: `[a-c]at`, seq: []byte("tab"), isMatch: true, canMatch: true},
+		{query: `(?i)[a-c]at`, seq: []byte("taB"), isMatch: true, canMatch: true},
+		// the empty pattern / empty string
+		{query: ``, seq: []byte{}, isMatch: true, canMatch: true},
+		{query: `a`, seq: []byte{}, isMatch: false, canMatch: true},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s - %v", test.query, test.seq), func(t *testing.T) {
+			fwd, err := New(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := fwd.Reverse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := r.Start()
+			for _, b := range test.seq {
+				s = r.Accept(s, b)
+			}
+
+			if isMatch := r.IsMatch(s); isMatch != test.isMatch {
+				t.Errorf("expected isMatch %t, got %t", test.isMatch, isMatch)
+			}
+			if canMatch := r.CanMatch(s); canMatch != test.canMatch {
+				t.Errorf("expected canMatch %t, got %t", test.canMatch, canMatch)
+			}
+		})
+	}
+}
+
+// TestReverseMultiPreservesMatchIDs confirms that Reversing a Regexp
+// built from NewMulti/NewMultiGlob keeps each pattern's own ID, rather
+// than reporting whichever pattern happened to be first.
+func TestReverseMultiPreservesMatchIDs(t *testing.T) {
+	fwd, err := NewMulti([]string{`cat`, `dog`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := fwd.Reverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		seq     []byte
+		matches []int
+	}{
+		{seq: []byte("tac"), matches: []int{0}},
+		{seq: []byte("god"), matches: []int{1}},
+		{seq: []byte("tab"), matches: nil},
+	}
+	for _, test := range tests {
+		t.Run(string(test.seq), func(t *testing.T) {
+			s := r.Start()
+			for _, b := range test.seq {
+				s = r.Accept(s, b)
+			}
+			got := r.MatchingPatterns(s)
+			if !reflect.DeepEqual(got, test.matches) {
+				t.Errorf("expected matching patterns %v, got %v", test.matches, got)
+			}
+		})
+	}
+}
+
+// TestReverseReportsGrowthOverflow confirms that Reverse returns a
+// descriptive error, rather than panicking, when reversal's extra nodes
+// (a byte-range node per consuming edge, plus fan-in instAlt nodes
+// wherever several edges share a target) push an ordinary, comfortably
+// under-the-cap union of patterns over maxStates.
+func TestReverseReportsGrowthOverflow(t *testing.T) {
+	var pats []string
+	for i := 0; i < 500; i++ {
+		pats = append(pats, fmt.Sprintf("a%d", i))
+	}
+	fwd, err := NewMulti(pats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fwd.dfa.insts) >= defaultMaxStates {
+		t.Fatalf("expected the forward automaton to stay under the cap, got %d instructions", len(fwd.dfa.insts))
+	}
+
+	if _, err := fwd.Reverse(); err == nil {
+		t.Fatal("expected Reverse to report an error once its extra nodes exceed the cap, got nil")
+	}
+}
+
+// TestReverseAgreesWithForward spot-checks that, for a handful of
+// patterns and inputs, Reverse() matches exactly the byte-reversals of
+// what the forward automaton matches.
+func TestReverseAgreesWithForward(t *testing.T) {
+	patterns := []string{`wat.r`, `a+|b+`, `[a-z]?[1-9]*`, `(?i)marty`}
+	inputs := []string{"water", "waterS", "aaa", "bbb", "ab", "a1", "", "MARTY"}
+
+	for _, p := range patterns {
+		fwd, err := New(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rev, err := fwd.Reverse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, in := range inputs {
+			t.Run(fmt.Sprintf("%s - %s", p, in), func(t *testing.T) {
+				fs := fwd.Start()
+				for _, b := range []byte(in) {
+					fs = fwd.Accept(fs, b)
+				}
+				fwdMatch := fwd.IsMatch(fs)
+
+				rs := rev.Start()
+				for _, b := range reverseBytes([]byte(in)) {
+					rs = rev.Accept(rs, b)
+				}
+				revMatch := rev.IsMatch(rs)
+
+				if fwdMatch != revMatch {
+					t.Errorf("forward match %t on %q but reverse match %t on %q", fwdMatch, in, revMatch, string(reverseBytes([]byte(in))))
+				}
+			})
+		}
+	}
+}
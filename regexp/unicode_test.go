@@ -0,0 +1,83 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regexp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUnicode(t *testing.T) {
+	tests := []struct {
+		query    string
+		seq      []byte
+		isMatch  bool
+		canMatch bool
+	}{
+		// \p{L} matches a single Unicode letter, multi-byte or not
+		{query: `\p{L}+`, seq: []byte("héllo"), isMatch: true, canMatch: true},
+		{query: `\p{L}+`, seq: []byte("h3llo"), isMatch: false, canMatch: false},
+		// \p{Nd} matches a decimal digit
+		{query: `\p{Nd}+`, seq: []byte("৩২"), isMatch: true, canMatch: true},
+		// \pM matches a combining mark: "e" plus a combining acute accent
+		{query: `e\pM`, seq: []byte("e\u0301"), isMatch: true, canMatch: true},
+		// negated Unicode class
+		{query: `\P{L}`, seq: []byte("7"), isMatch: true, canMatch: true},
+		{query: `\P{L}`, seq: []byte("a"), isMatch: false, canMatch: false},
+		// case folding survives outside ASCII: Greek sigma/capital sigma
+		{query: `(?i)σ`, seq: []byte("Σ"), isMatch: true, canMatch: true},
+		{query: `(?i)i`, seq: []byte("I"), isMatch: true, canMatch: true},
+		// a negated class must not match the continuation bytes of a
+		// multi-byte rune it excludes
+		{query: `[^é]`, seq: []byte("é")[:1], isMatch: false, canMatch: true},
+		{query: `[^é]`, seq: []byte("é"), isMatch: false, canMatch: false},
+		{query: `[^é]`, seq: []byte("e"), isMatch: true, canMatch: true},
+		// a rune range spanning the surrogate gap (D800-DFFF) must not
+		// accept the byte sequence a surrogate would encode to, even
+		// though it falls between two runes the range does include
+		{query: `[\x{D700}-\x{E100}]`, seq: []byte{0xed, 0x9f, 0xbf}, isMatch: true, canMatch: true},   // U+D7FF, just below the gap
+		{query: `[\x{D700}-\x{E100}]`, seq: []byte{0xee, 0x80, 0x80}, isMatch: true, canMatch: true},   // U+E000, just above the gap
+		{query: `[\x{D700}-\x{E100}]`, seq: []byte{0xed, 0xa0, 0x80}, isMatch: false, canMatch: false}, // U+D800, inside the gap
+		// Unicode case folding follows SimpleFold orbits, not a naive
+		// ASCII-only upper/lower mapping: U+0130 (LATIN CAPITAL LETTER I
+		// WITH DOT ABOVE, Turkish İ) has no simple fold partner, so it
+		// must not be conflated with ASCII "i"/"I" the way it would be
+		// under Turkish-locale-aware casing
+		{query: `(?i)İ`, seq: []byte("İ"), isMatch: true, canMatch: true},
+		{query: `(?i)İ`, seq: []byte("i"), isMatch: false, canMatch: false},
+		{query: `(?i)İ`, seq: []byte("I"), isMatch: false, canMatch: false},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s - %v", test.query, test.seq), func(t *testing.T) {
+			r, err := New(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := r.Start()
+			for _, b := range test.seq {
+				s = r.Accept(s, b)
+			}
+
+			if isMatch := r.IsMatch(s); isMatch != test.isMatch {
+				t.Errorf("expected isMatch %t, got %t", test.isMatch, isMatch)
+			}
+			if canMatch := r.CanMatch(s); canMatch != test.canMatch {
+				t.Errorf("expected canMatch %t, got %t", test.canMatch, canMatch)
+			}
+		})
+	}
+}
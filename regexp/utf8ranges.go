@@ -0,0 +1,143 @@
+//  Copyright (c) 2017 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regexp
+
+import "unicode/utf8"
+
+// byteRange is an inclusive [lo, hi] range a single byte can fall in.
+type byteRange struct{ lo, hi byte }
+
+// continuation bytes of a multi-byte UTF-8 sequence always fall in
+// [0x80, 0xbf].
+const contLo, contHi byte = 0x80, 0xbf
+
+const (
+	maxRune1 = 0x7f
+	maxRune2 = 0x7ff
+	maxRune3 = 0xffff
+	maxRune4 = utf8.MaxRune
+
+	surrogateMin = 0xd800
+	surrogateMax = 0xdfff
+)
+
+// utf8Sequences decomposes the inclusive rune range [lo, hi] into a set
+// of byte-range sequences: a byte string matches the overall range if
+// and only if it matches every byteRange of exactly one returned
+// sequence, position for position. This is the standard prefix-byte /
+// middle-bytes / suffix-byte decomposition (the same one the Go regexp
+// package's onePassCopy and BurntSushi's utf8-ranges crate use) that
+// lets a byte-at-a-time dfa walk UTF-8 without ever decoding a rune.
+func utf8Sequences(lo, hi rune) [][]byteRange {
+	var out [][]byteRange
+	splitRuneRange(lo, hi, &out)
+	return out
+}
+
+func splitRuneRange(lo, hi rune, out *[][]byteRange) {
+	if lo > hi {
+		return
+	}
+
+	// Surrogates (0xd800-0xdfff) are never valid UTF-8; exclude them so a
+	// class like \p{L} can't accidentally accept an invalid encoding.
+	if lo < surrogateMin && hi >= surrogateMin {
+		splitBound := rune(surrogateMin - 1)
+		splitRuneRange(lo, splitBound, out)
+		if hi > surrogateMax {
+			splitRuneRange(surrogateMax+1, hi, out)
+		}
+		return
+	}
+	if lo >= surrogateMin && lo <= surrogateMax {
+		if hi > surrogateMax {
+			splitRuneRange(surrogateMax+1, hi, out)
+		}
+		return
+	}
+
+	// Split at UTF-8 encoded-length boundaries so lo and hi below always
+	// encode to the same number of bytes.
+	for _, boundary := range [...]rune{maxRune1, maxRune2, maxRune3} {
+		if lo <= boundary && hi > boundary {
+			splitRuneRange(lo, boundary, out)
+			splitRuneRange(boundary+1, hi, out)
+			return
+		}
+	}
+
+	var loBuf, hiBuf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(loBuf[:], lo)
+	utf8.EncodeRune(hiBuf[:], hi)
+	*out = append(*out, splitByteRange(loBuf[:n], hiBuf[:n])...)
+}
+
+// splitByteRange decomposes [lo, hi], two same-length UTF-8 encodings,
+// into sequences of byteRanges.
+func splitByteRange(lo, hi []byte) [][]byteRange {
+	if len(lo) == 1 {
+		return [][]byteRange{{{lo: lo[0], hi: hi[0]}}}
+	}
+	if lo[0] == hi[0] {
+		var out [][]byteRange
+		for _, rest := range splitByteRange(lo[1:], hi[1:]) {
+			out = append(out, append([]byteRange{{lo: lo[0], hi: lo[0]}}, rest...))
+		}
+		return out
+	}
+
+	var out [][]byteRange
+	loFirst, hiFirst := lo[0], hi[0]
+
+	if !isAllContinuation(lo[1:], contLo) {
+		maxCont := repeat(contHi, len(lo)-1)
+		for _, rest := range splitByteRange(lo[1:], maxCont) {
+			out = append(out, append([]byteRange{{lo: loFirst, hi: loFirst}}, rest...))
+		}
+		loFirst++
+	}
+	if !isAllContinuation(hi[1:], contHi) {
+		minCont := repeat(contLo, len(hi)-1)
+		for _, rest := range splitByteRange(minCont, hi[1:]) {
+			out = append(out, append([]byteRange{{lo: hiFirst, hi: hiFirst}}, rest...))
+		}
+		hiFirst--
+	}
+	if loFirst <= hiFirst {
+		rest := make([]byteRange, len(lo)-1)
+		for i := range rest {
+			rest[i] = byteRange{lo: contLo, hi: contHi}
+		}
+		out = append(out, append([]byteRange{{lo: loFirst, hi: hiFirst}}, rest...))
+	}
+	return out
+}
+
+func isAllContinuation(b []byte, v byte) bool {
+	for _, c := range b {
+		if c != v {
+			return false
+		}
+	}
+	return true
+}
+
+func repeat(b byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = b
+	}
+	return out
+}